@@ -0,0 +1,65 @@
+// Package conversation implements the step-by-step Kindle email
+// onboarding flow: pick a region, enter an email, receive a
+// verification file, confirm the sender is whitelisted.
+package conversation
+
+import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+// Step identifies where a user is in the onboarding flow. State is
+// persisted so the flow survives a bot restart mid-conversation.
+type Step string
+
+const (
+	StepRegion    Step = "region"
+	StepEmail     Step = "email"
+	StepWhitelist Step = "whitelist"
+)
+
+// State is a single user's progress through onboarding.
+type State struct {
+	Step   Step
+	Region string
+	Email  string
+}
+
+// Callback data values carried by the inline keyboard buttons this
+// package builds. handleCallbackQuery switches on these.
+const (
+	CallbackRegionKindle     = "onboarding:region:kindle.com"
+	CallbackRegionFreeKindle = "onboarding:region:free.kindle.com"
+	CallbackWhitelistDone    = "onboarding:whitelist:done"
+)
+
+// RegionKeyboard asks the user whether their Kindle uses kindle.com or
+// the free.kindle.com (experimental/device-only) email domain.
+func RegionKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("kindle.com", CallbackRegionKindle),
+			tgbotapi.NewInlineKeyboardButtonData("free.kindle.com", CallbackRegionFreeKindle),
+		),
+	)
+}
+
+// WhitelistKeyboard confirms the user has approved the bot's sender
+// address in their Amazon "Personal Document Settings".
+func WhitelistKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("I've whitelisted it", CallbackWhitelistDone),
+		),
+	)
+}
+
+// RegionFromCallback maps a region callback's data to the email domain
+// it represents, returning false if data isn't a region callback.
+func RegionFromCallback(data string) (string, bool) {
+	switch data {
+	case CallbackRegionKindle:
+		return "kindle.com", true
+	case CallbackRegionFreeKindle:
+		return "free.kindle.com", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,43 @@
+// Package converter turns book and article content between the formats
+// Send-to-Kindle can accept.
+package converter
+
+import (
+	"fmt"
+
+	"github.com/bmaupin/go-epub"
+)
+
+// Article is a piece of extracted web content ready to be rendered to
+// EPUB.
+type Article struct {
+	Title   string
+	Author  string
+	SiteURL string
+	HTML    string
+}
+
+// RenderArticleToEPUB wraps an extracted article's HTML in a minimal
+// single-chapter EPUB, so it reads like a short book on a Kindle.
+func RenderArticleToEPUB(article Article) ([]byte, error) {
+	book := epub.NewEpub(article.Title)
+
+	if article.Author != "" {
+		book.SetAuthor(article.Author)
+	}
+	if article.SiteURL != "" {
+		book.SetDescription(fmt.Sprintf("Fetched from %s", article.SiteURL))
+	}
+
+	if _, err := book.AddSection(article.HTML, article.Title, "", ""); err != nil {
+		return nil, fmt.Errorf("error adding article section: %w", err)
+	}
+
+	path, err := writeTempEpub(book)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering article to epub: %w", err)
+	}
+	defer removeTemp(path)
+
+	return readFile(path)
+}
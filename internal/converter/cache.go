@@ -0,0 +1,42 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Cache stores converted output on disk, keyed by the SHA-256 of its
+// input plus the target format, so re-sending the same file (e.g. via
+// /history) skips re-conversion.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a Cache rooted at dir, creating it if necessary.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating converter cache dir: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Key returns the cache key for converting input to targetFormat.
+func Key(input []byte, targetFormat string) string {
+	sum := sha256.Sum256(input)
+	return fmt.Sprintf("%s.%s", hex.EncodeToString(sum[:]), targetFormat)
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *Cache) Put(key string, data []byte) error {
+	return os.WriteFile(filepath.Join(c.dir, key), data, 0644)
+}
@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// calibreConverter shells out to Calibre's `ebook-convert` CLI, which
+// handles every format Send-to-Kindle cares about (EPUB/MOBI/AZW3/PDF).
+type calibreConverter struct{}
+
+// NewCalibreConverter returns a Converter backed by a local Calibre
+// install. Callers should check exec.LookPath("ebook-convert") first;
+// Convert itself will just fail if the binary isn't on PATH.
+func NewCalibreConverter() Converter {
+	return calibreConverter{}
+}
+
+func (calibreConverter) Convert(ctx context.Context, input []byte, mimeType string, targetFormat string) ([]byte, error) {
+	srcExt := extensionForMimeType(mimeType)
+	if srcExt == "" {
+		return nil, fmt.Errorf("unsupported source mime type: %q", mimeType)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "btk-convert-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcPath := filepath.Join(tmpDir, "input"+srcExt)
+	dstPath := filepath.Join(tmpDir, "output."+targetFormat)
+
+	if err := os.WriteFile(srcPath, input, 0644); err != nil {
+		return nil, fmt.Errorf("error writing input file: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "ebook-convert", srcPath, dstPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ebook-convert failed: %w: %s", err, output)
+	}
+
+	converted, err := os.ReadFile(dstPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading converted file: %w", err)
+	}
+
+	return converted, nil
+}
+
+func extensionForMimeType(mimeType string) string {
+	switch mimeType {
+	case "application/epub+zip":
+		return ".epub"
+	case "application/pdf":
+		return ".pdf"
+	case "application/x-mobipocket-ebook":
+		return ".mobi"
+	case "application/vnd.amazon.ebook":
+		return ".azw3"
+	default:
+		return ""
+	}
+}
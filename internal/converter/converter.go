@@ -0,0 +1,10 @@
+package converter
+
+import "context"
+
+// Converter transcodes or optimizes a book so Send-to-Kindle accepts it:
+// EPUB -> AZW3/MOBI, or a PDF downscaled and linearized in place.
+// targetFormat is a bare extension such as "azw3", "mobi", or "pdf".
+type Converter interface {
+	Convert(ctx context.Context, input []byte, mimeType string, targetFormat string) ([]byte, error)
+}
@@ -0,0 +1,13 @@
+package converter
+
+import "os/exec"
+
+// NewDefaultConverter returns the Calibre-backed Converter if
+// ebook-convert is on PATH, falling back to the reduced-capability
+// pure-Go converter otherwise.
+func NewDefaultConverter() Converter {
+	if _, err := exec.LookPath("ebook-convert"); err == nil {
+		return NewCalibreConverter()
+	}
+	return NewPureGoConverter()
+}
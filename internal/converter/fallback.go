@@ -0,0 +1,40 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// ErrUnsupported means the conversion was rejected outright rather than
+// failing transiently, so retrying it won't help: callers should
+// dead-letter the job instead of burning retries on it.
+var ErrUnsupported = errors.New("conversion not supported by this backend")
+
+// pureGoConverter is the fallback used when Calibre's `ebook-convert`
+// isn't installed. It can only optimize PDFs in place (downscale
+// images, linearize); unlike calibreConverter it cannot transcode
+// between ebook formats, since go-epub can only write EPUB.
+type pureGoConverter struct{}
+
+// NewPureGoConverter returns a dependency-free Converter with reduced
+// capabilities, for environments without Calibre installed.
+func NewPureGoConverter() Converter {
+	return pureGoConverter{}
+}
+
+func (pureGoConverter) Convert(ctx context.Context, input []byte, mimeType string, targetFormat string) ([]byte, error) {
+	if mimeType != "application/pdf" || targetFormat != "pdf" {
+		return nil, fmt.Errorf("%w: pure-go converter can only optimize PDFs; install Calibre to convert %s to %s", ErrUnsupported, mimeType, targetFormat)
+	}
+
+	var out bytes.Buffer
+	if err := api.Optimize(bytes.NewReader(input), &out, nil); err != nil {
+		return nil, fmt.Errorf("error optimizing pdf: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
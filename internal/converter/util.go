@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bmaupin/go-epub"
+)
+
+// writeTempEpub writes book to a unique temp file, since go-epub only
+// knows how to write to a path rather than an io.Writer. Concurrent
+// calls (one per job worker) must each get their own path, so this
+// can't key on something shared like the process PID.
+func writeTempEpub(book *epub.Epub) (string, error) {
+	tmp, err := os.CreateTemp(os.TempDir(), "btk-*.epub")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp file: %w", err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+
+	if err := book.Write(path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func removeTemp(path string) {
+	_ = os.Remove(path)
+}
+
+func readFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
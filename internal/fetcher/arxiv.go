@@ -0,0 +1,41 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// arxivFetcher downloads the PDF of an arXiv paper, converting an
+// "/abs/" landing page URL into the matching "/pdf/" URL.
+type arxivFetcher struct{}
+
+func (arxivFetcher) CanHandle(u *url.URL) bool {
+	return hasSuffixHost(u, "arxiv.org")
+}
+
+func (arxivFetcher) Fetch(ctx context.Context, client *http.Client, u *url.URL, maxBytes int64) (Result, error) {
+	id := strings.TrimPrefix(path.Clean(u.Path), "/")
+	id = strings.TrimPrefix(id, "abs/")
+	id = strings.TrimPrefix(id, "pdf/")
+	id = strings.TrimSuffix(id, ".pdf")
+
+	if id == "" {
+		return Result{}, fmt.Errorf("could not determine arXiv id from %q", u)
+	}
+
+	downloadURL := fmt.Sprintf("https://arxiv.org/pdf/%s.pdf", id)
+	bytes, err := download(ctx, client, downloadURL, maxBytes)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		FileName: fmt.Sprintf("arxiv-%s.pdf", strings.ReplaceAll(id, "/", "-")),
+		MimeType: "application/pdf",
+		Bytes:    bytes,
+	}, nil
+}
@@ -0,0 +1,117 @@
+// Package fetcher turns a URL a user sends the bot into a downloadable
+// book, dispatching to a per-host strategy: public-domain archives are
+// downloaded directly, everything else is extracted and rendered to
+// EPUB.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrTooLarge wraps a Fetch error caused by the response exceeding its
+// maxBytes cap, so callers can tell it apart from a transient failure
+// worth retrying.
+var ErrTooLarge = errors.New("response too large")
+
+// Result is a fetched, ready-to-send book.
+type Result struct {
+	FileName string
+	MimeType string
+	Bytes    []byte
+}
+
+// Fetcher turns a URL into a Result. maxBytes caps how much of the
+// response a Fetch implementation may buffer, so a huge or slow-trickle
+// response is rejected while streaming rather than after it's fully in
+// memory.
+type Fetcher interface {
+	CanHandle(u *url.URL) bool
+	Fetch(ctx context.Context, client *http.Client, u *url.URL, maxBytes int64) (Result, error)
+}
+
+// fetchers is tried in order; the first one whose CanHandle matches the
+// URL's host wins. genericFetcher is last and matches everything, so it
+// always catches whatever the host-specific fetchers don't.
+var fetchers = []Fetcher{
+	gutenbergFetcher{},
+	standardEbooksFetcher{},
+	arxivFetcher{},
+	genericFetcher{},
+}
+
+// Fetch downloads and, if necessary, converts the document at rawURL.
+// maxBytes caps how large the fetched document may be.
+func Fetch(ctx context.Context, client *http.Client, rawURL string, maxBytes int64) (Result, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Result{}, fmt.Errorf("unsupported URL scheme: %q", u.Scheme)
+	}
+
+	for _, f := range fetchers {
+		if f.CanHandle(u) {
+			return f.Fetch(ctx, client, u, maxBytes)
+		}
+	}
+
+	return Result{}, fmt.Errorf("no fetcher could handle %q", rawURL)
+}
+
+func hasSuffixHost(u *url.URL, hosts ...string) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+func download(ctx context.Context, client *http.Client, rawURL string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %q: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d downloading %q", resp.StatusCode, rawURL)
+	}
+
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	return readLimited(resp.Body, maxBytes)
+}
+
+// readLimited reads from r, rejecting the response with ErrTooLarge if
+// more than maxBytes are available instead of silently truncating it.
+// It never buffers more than maxBytes+1 bytes, so it caps memory use
+// even against a response with no (or a lying) Content-Length.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("%w: exceeds the %d byte limit", ErrTooLarge, maxBytes)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,70 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	readability "github.com/go-shiori/go-readability"
+
+	"github.com/yinkakun/book-to-kindle-bot/internal/converter"
+)
+
+// genericFetcher handles any URL the host-specific fetchers don't claim:
+// it downloads the page, runs it through a readability extractor to
+// strip navigation/ads, and renders the remaining article to EPUB.
+type genericFetcher struct{}
+
+func (genericFetcher) CanHandle(u *url.URL) bool {
+	return true
+}
+
+func (genericFetcher) Fetch(ctx context.Context, client *http.Client, u *url.URL, maxBytes int64) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("error building request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("error downloading %q: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxBytes {
+		return Result{}, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	body, err := readLimited(resp.Body, maxBytes)
+	if err != nil {
+		return Result{}, fmt.Errorf("error downloading %q: %w", u, err)
+	}
+
+	article, err := readability.FromReader(bytes.NewReader(body), u)
+	if err != nil {
+		return Result{}, fmt.Errorf("error extracting article from %q: %w", u, err)
+	}
+
+	title := article.Title
+	if title == "" {
+		title = u.String()
+	}
+
+	epubBytes, err := converter.RenderArticleToEPUB(converter.Article{
+		Title:   title,
+		Author:  article.Byline,
+		SiteURL: u.String(),
+		HTML:    article.Content,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		FileName: title + ".epub",
+		MimeType: "application/epub+zip",
+		Bytes:    epubBytes,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// gutenbergFetcher downloads the EPUB of a Project Gutenberg book
+// directly, rather than extracting the HTML reader page.
+type gutenbergFetcher struct{}
+
+func (gutenbergFetcher) CanHandle(u *url.URL) bool {
+	return hasSuffixHost(u, "gutenberg.org")
+}
+
+func (gutenbergFetcher) Fetch(ctx context.Context, client *http.Client, u *url.URL, maxBytes int64) (Result, error) {
+	id := gutenbergBookID(u.Path)
+	if id == "" {
+		return Result{}, fmt.Errorf("could not determine Gutenberg book id from %q", u)
+	}
+
+	downloadURL := fmt.Sprintf("https://www.gutenberg.org/ebooks/%s.epub3.images", id)
+	bytes, err := download(ctx, client, downloadURL, maxBytes)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		FileName: fmt.Sprintf("gutenberg-%s.epub", id),
+		MimeType: "application/epub+zip",
+		Bytes:    bytes,
+	}, nil
+}
+
+// gutenbergBookID extracts the numeric book id from paths like
+// "/ebooks/1342" or "/files/1342/1342-h/1342-h.htm".
+func gutenbergBookID(p string) string {
+	for _, part := range strings.Split(path.Clean(p), "/") {
+		if part != "" && isDigits(part) {
+			return part
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// standardEbooksFetcher downloads the "compatible" EPUB build Standard
+// Ebooks publishes for every title, which Send-to-Kindle accepts.
+type standardEbooksFetcher struct{}
+
+func (standardEbooksFetcher) CanHandle(u *url.URL) bool {
+	return hasSuffixHost(u, "standardebooks.org")
+}
+
+func (standardEbooksFetcher) Fetch(ctx context.Context, client *http.Client, u *url.URL, maxBytes int64) (Result, error) {
+	slug := strings.Trim(path.Clean(u.Path), "/")
+	if slug == "" {
+		return Result{}, fmt.Errorf("could not determine Standard Ebooks slug from %q", u)
+	}
+
+	downloadURL := fmt.Sprintf("https://standardebooks.org/ebooks/%s/downloads/%s.epub", slug, strings.ReplaceAll(slug, "/", "_"))
+	bytes, err := download(ctx, client, downloadURL, maxBytes)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		FileName: fmt.Sprintf("%s.epub", strings.ReplaceAll(slug, "/", "-")),
+		MimeType: "application/epub+zip",
+		Bytes:    bytes,
+	}, nil
+}
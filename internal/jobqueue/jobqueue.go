@@ -0,0 +1,57 @@
+// Package jobqueue defines the durable delivery job model used to make
+// uploads and fetches survive a restart instead of being lost with the
+// goroutine that was processing them.
+package jobqueue
+
+import (
+	"math/rand"
+	"time"
+)
+
+// State is where a Job sits in its lifecycle.
+type State string
+
+const (
+	StateQueued     State = "queued"
+	StateInProgress State = "in_progress"
+	StateDone       State = "done"
+	StateDeadLetter State = "dead_letter"
+)
+
+// Kind is what kind of source a Job delivers from.
+type Kind string
+
+const (
+	KindDocument Kind = "document"
+	KindURL      Kind = "url"
+)
+
+// MaxAttempts is how many times a job is retried before it's moved to
+// StateDeadLetter and left for the user to resurrect with /retry.
+const MaxAttempts = 5
+
+// Job is a single durable delivery task, persisted in the jobs table so
+// it can be resumed after a crash or restart.
+type Job struct {
+	ID         int64
+	TelegramID int64
+	ChatID     int64
+	Kind       Kind
+	FileID     string
+	FileName   string
+	MimeType   string
+	URL        string
+	Attempts   int
+}
+
+// NextAttemptDelay returns how long to wait before retrying a job that
+// has already failed attempts times, using exponential backoff with
+// full jitter so a burst of failures doesn't retry in lockstep.
+func NextAttemptDelay(attempts int) time.Duration {
+	backoff := time.Second * time.Duration(int64(1)<<uint(attempts))
+	const maxBackoff = 5 * time.Minute
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
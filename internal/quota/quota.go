@@ -0,0 +1,99 @@
+// Package quota enforces per-user delivery limits, so a single abusive
+// or buggy client can't loop-forward uploads into Amazon's Send-to-Kindle
+// rate limits on everyone else's behalf.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// UsageStore persists per-user daily usage so quotas survive restarts.
+// Db implements this against the quota_usage table.
+type UsageStore interface {
+	GetUsageToday(ctx context.Context, telegramId int64) (books int, bytes int64, err error)
+	RecordUsage(ctx context.Context, telegramId int64, fileSize int) error
+}
+
+// Limits are the configurable daily caps enforced by a Checker.
+type Limits struct {
+	MaxBooksPerDay int
+	MaxBytesPerDay int64
+}
+
+// Checker enforces Limits per user, backed by UsageStore for the daily
+// counters and an in-memory token bucket per user for short-term burst
+// protection.
+type Checker struct {
+	store  UsageStore
+	limits Limits
+
+	mu       sync.Mutex
+	limiters map[int64]*rate.Limiter
+}
+
+// NewChecker returns a Checker enforcing limits, persisting daily usage
+// through store.
+func NewChecker(store UsageStore, limits Limits) *Checker {
+	return &Checker{
+		store:    store,
+		limits:   limits,
+		limiters: make(map[int64]*rate.Limiter),
+	}
+}
+
+func (c *Checker) limiterFor(telegramId int64) *rate.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limiter, ok := c.limiters[telegramId]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(time.Minute), 3)
+		c.limiters[telegramId] = limiter
+	}
+
+	return limiter
+}
+
+// Allow reports whether telegramId may send a book of fileSize bytes
+// right now. If not, reason is a message suitable to show the user and
+// resetsIn is how long until the daily quota resets (zero when the
+// rejection is the short-term burst limiter, which has no fixed reset).
+func (c *Checker) Allow(ctx context.Context, telegramId int64, fileSize int) (allowed bool, reason string, resetsIn time.Duration, err error) {
+	if !c.limiterFor(telegramId).Allow() {
+		return false, "you're sending books too quickly, please slow down and try again in a minute", 0, nil
+	}
+
+	books, bytesSent, err := c.store.GetUsageToday(ctx, telegramId)
+	if err != nil {
+		return false, "", 0, fmt.Errorf("error reading today's usage: %w", err)
+	}
+
+	if books >= c.limits.MaxBooksPerDay {
+		return false, fmt.Sprintf("you've hit today's limit of %d books", c.limits.MaxBooksPerDay), timeUntilResetUTC(), nil
+	}
+
+	if bytesSent+int64(fileSize) > c.limits.MaxBytesPerDay {
+		return false, fmt.Sprintf("you've hit today's %dMB limit", c.limits.MaxBytesPerDay/(1024*1024)), timeUntilResetUTC(), nil
+	}
+
+	return true, "", 0, nil
+}
+
+// Record accounts for a book actually delivered, so subsequent Allow
+// calls see it.
+func (c *Checker) Record(ctx context.Context, telegramId int64, fileSize int) error {
+	return c.store.RecordUsage(ctx, telegramId, fileSize)
+}
+
+// timeUntilResetUTC is how long until quotas, which reset at UTC
+// midnight, next reset.
+func timeUntilResetUTC() time.Duration {
+	now := time.Now().UTC()
+	nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return nextMidnight.Sub(now)
+}
@@ -0,0 +1,24 @@
+package quota
+
+// Semaphore bounds how many deliveries can be processed concurrently
+// across all users, replacing the ad-hoc channel-based worker pool that
+// used to live directly in Start.
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore returns a Semaphore allowing up to capacity concurrent
+// holders.
+func NewSemaphore(capacity int) *Semaphore {
+	return &Semaphore{slots: make(chan struct{}, capacity)}
+}
+
+// Acquire blocks until a slot is free.
+func (s *Semaphore) Acquire() {
+	s.slots <- struct{}{}
+}
+
+// Release frees a slot acquired with Acquire.
+func (s *Semaphore) Release() {
+	<-s.slots
+}
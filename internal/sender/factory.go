@@ -0,0 +1,58 @@
+package sender
+
+import (
+	"fmt"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Factory builds a Sender for a given delivery method, wiring in
+// credentials and clients gathered once at startup.
+type Factory struct {
+	bot      *tgbotapi.BotAPI
+	botEmail string
+}
+
+// NewFactory returns a Factory that can build every supported Sender.
+func NewFactory(bot *tgbotapi.BotAPI, botEmail string) *Factory {
+	return &Factory{bot: bot, botEmail: botEmail}
+}
+
+// Build returns the Sender for method, wrapped with the shared retry
+// behaviour, reading any credentials it needs from the environment.
+func (f *Factory) Build(method Method) (Sender, error) {
+	switch method {
+	case MethodSESSMTP:
+		return WithRetry(NewSESSMTPSender(SMTPConfig{
+			Username: os.Getenv("AWS_SES_SMTP_USERNAME"),
+			Password: os.Getenv("AWS_SES_SMTP_PASSWORD"),
+			From:     f.botEmail,
+		})), nil
+	case MethodSMTP:
+		return WithRetry(NewSMTPSender(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     smtpPortOrDefault(os.Getenv("SMTP_PORT")),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     f.botEmail,
+		})), nil
+	case MethodTelegram:
+		return WithRetry(NewTelegramSender(f.bot)), nil
+	default:
+		return nil, fmt.Errorf("unknown delivery method: %q", method)
+	}
+}
+
+func smtpPortOrDefault(port string) int {
+	if port == "" {
+		return 587
+	}
+
+	var p int
+	if _, err := fmt.Sscanf(port, "%d", &p); err != nil {
+		return 587
+	}
+
+	return p
+}
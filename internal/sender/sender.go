@@ -0,0 +1,64 @@
+// Package sender delivers a converted book to a user through one of
+// several pluggable delivery methods (email, Telegram file reply, ...).
+package sender
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Method identifies a delivery mechanism a user can choose via /set_delivery.
+type Method string
+
+const (
+	MethodSESSMTP     Method = "ses_smtp"
+	MethodSMTP        Method = "smtp"
+	MethodTelegram    Method = "telegram"
+	DefaultMethod            = MethodSESSMTP
+)
+
+// Book is the payload handed to a Sender for delivery.
+type Book struct {
+	FileName string
+	FileSize int
+	Bytes    []byte
+}
+
+// Sender delivers a Book to a destination address. The meaning of Address
+// is sender-specific: an email address for the SMTP senders, a chat ID
+// (as a string) for the Telegram sender.
+type Sender interface {
+	Send(ctx context.Context, address string, book Book) error
+}
+
+// Prefs are a user's stored delivery preferences.
+type Prefs struct {
+	Method  Method
+	Address string
+	Format  string
+}
+
+// WithRetry wraps a Sender so that transient delivery errors are retried
+// with exponential backoff. This is the same retry behaviour `sendEmail`
+// used to have inline, now shared across every Sender implementation.
+func WithRetry(s Sender) Sender {
+	return retryingSender{s}
+}
+
+type retryingSender struct {
+	inner Sender
+}
+
+func (r retryingSender) Send(ctx context.Context, address string, book Book) error {
+	err := backoff.Retry(func() error {
+		return r.inner.Send(ctx, address, book)
+	}, backoff.WithContext(backoff.NewExponentialBackOff(), ctx))
+
+	if err != nil {
+		return fmt.Errorf("error sending book via %T: %w", r.inner, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package sender
+
+import (
+	"context"
+	"io"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SMTPConfig configures an smtpSender.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// smtpSender emails the book as an attachment through a generic SMTP
+// relay. NewSESSMTPSender and NewSMTPSender both return one of these,
+// pointed at different hosts.
+type smtpSender struct {
+	config SMTPConfig
+}
+
+// NewSESSMTPSender returns a Sender that delivers through AWS SES's SMTP
+// endpoint, matching the behaviour the original sendEmail hard-coded.
+func NewSESSMTPSender(config SMTPConfig) Sender {
+	if config.Host == "" {
+		config.Host = "email-smtp.us-east-1.amazonaws.com"
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return smtpSender{config}
+}
+
+// NewSMTPSender returns a Sender that delivers through an arbitrary SMTP
+// relay, for users whose Kindle delivery method isn't SES.
+func NewSMTPSender(config SMTPConfig) Sender {
+	return smtpSender{config}
+}
+
+func (s smtpSender) Send(ctx context.Context, address string, book Book) error {
+	m := gomail.NewMessage()
+
+	m.SetHeader("To", address)
+	m.SetHeader("From", s.config.From)
+	m.SetHeader("Subject", "BookToKindleBot")
+
+	m.Attach(book.FileName, gomail.SetCopyFunc(func(w io.Writer) error {
+		_, err := w.Write(book.Bytes)
+		return err
+	}))
+
+	d := gomail.NewDialer(s.config.Host, s.config.Port, s.config.Username, s.config.Password)
+	return d.DialAndSend(m)
+}
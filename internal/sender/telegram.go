@@ -0,0 +1,39 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegramSender uploads the converted book back to the chat it came
+// from, instead of emailing it. This is useful for users who haven't
+// set up a Kindle email yet, or who just want the file.
+type telegramSender struct {
+	bot *tgbotapi.BotAPI
+}
+
+// NewTelegramSender returns a Sender that replies with the file in the
+// originating Telegram chat. Address is the chat ID formatted as a
+// string, matching Prefs.Address for MethodTelegram.
+func NewTelegramSender(bot *tgbotapi.BotAPI) Sender {
+	return telegramSender{bot: bot}
+}
+
+func (s telegramSender) Send(ctx context.Context, address string, book Book) error {
+	chatId, err := strconv.ParseInt(address, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram chat id %q: %w", address, err)
+	}
+
+	file := tgbotapi.FileBytes{Name: book.FileName, Bytes: book.Bytes}
+	document := tgbotapi.NewDocument(chatId, file)
+
+	if _, err := s.bot.Send(document); err != nil {
+		return fmt.Errorf("error uploading document to chat %d: %w", chatId, err)
+	}
+
+	return nil
+}
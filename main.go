@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,14 +11,25 @@ import (
 	"net/http"
 	"net/mail"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
-	"gopkg.in/gomail.v2"
 	_ "modernc.org/sqlite"
+
+	"github.com/yinkakun/book-to-kindle-bot/internal/conversation"
+	"github.com/yinkakun/book-to-kindle-bot/internal/converter"
+	"github.com/yinkakun/book-to-kindle-bot/internal/fetcher"
+	"github.com/yinkakun/book-to-kindle-bot/internal/jobqueue"
+	"github.com/yinkakun/book-to-kindle-bot/internal/quota"
+	"github.com/yinkakun/book-to-kindle-bot/internal/sender"
 )
 
 type BotConfig struct {
@@ -27,6 +39,9 @@ type BotConfig struct {
 	TelegramToken   string
 	MaxFileSize     int
 	DownloadTimeout time.Duration
+	DailyBookLimit  int
+	DailyByteLimit  int64
+	AdminIDs        []int64
 }
 
 const dbSchema = `
@@ -40,10 +55,55 @@ const dbSchema = `
 		book_name TEXT NOT NULL,
 		file_size INTEGER NOT NULL,
 		telegram_id INTEGER NOT NULL,
+		source_url TEXT NOT NULL DEFAULT '',
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id)
 	);
+
+	CREATE TABLE IF NOT EXISTS delivery_prefs (
+		telegram_id INTEGER PRIMARY KEY,
+		method TEXT NOT NULL,
+		address TEXT NOT NULL,
+		format TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_state (
+		telegram_id INTEGER PRIMARY KEY,
+		step TEXT NOT NULL,
+		region TEXT NOT NULL DEFAULT '',
+		email TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS quota_usage (
+		telegram_id INTEGER NOT NULL,
+		date TEXT NOT NULL,
+		books_sent INTEGER NOT NULL DEFAULT 0,
+		bytes_sent INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (telegram_id, date)
+	);
+
+	CREATE TABLE IF NOT EXISTS banned_users (
+		telegram_id INTEGER PRIMARY KEY,
+		banned_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		telegram_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		file_id TEXT NOT NULL DEFAULT '',
+		file_name TEXT NOT NULL DEFAULT '',
+		mime_type TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL DEFAULT '',
+		state TEXT NOT NULL DEFAULT 'queued',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 `
 
 type Db struct {
@@ -55,8 +115,15 @@ type BookToKindleBot struct {
 	config         BotConfig
 	httpClient     *http.Client
 	telegramBotApi *tgbotapi.BotAPI
+	senderFactory  *sender.Factory
+	converter      converter.Converter
+	convCache      *converter.Cache
+	quotaChecker   *quota.Checker
+	concurrency    *quota.Semaphore
 }
 
+var kindleEmailDomains = []string{"kindle.com", "free.kindle.com"}
+
 var supportedMimeTypes = map[string]bool{
 	"application/pdf":                true,
 	"application/epub+zip":           true,
@@ -101,11 +168,236 @@ func (db *Db) SetKindleEmail(ctx context.Context, telegramId int64, kindleEmail
 	return err
 }
 
-func (db *Db) logSentBook(ctx context.Context, telegramId int64, bookName string, fileSize int) error {
-	_, err := db.ExecContext(ctx, "INSERT INTO sent_books (book_name, file_size, telegram_id) VALUES (?, ?, ?)", bookName, fileSize, telegramId)
+func (db *Db) logSentBook(ctx context.Context, telegramId int64, bookName string, fileSize int, sourceURL string) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO sent_books (book_name, file_size, telegram_id, source_url) VALUES (?, ?, ?, ?)", bookName, fileSize, telegramId, sourceURL)
+	return err
+}
+
+// SentBook is a single past delivery, as shown by /history.
+type SentBook struct {
+	BookName  string
+	SourceURL string
+}
+
+func (db *Db) GetSentBooksWithSource(ctx context.Context, telegramId int64) ([]SentBook, error) {
+	rows, err := db.QueryContext(ctx, "SELECT book_name, source_url FROM sent_books WHERE telegram_id = ? ORDER BY id DESC", telegramId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []SentBook
+	for rows.Next() {
+		var book SentBook
+		if err := rows.Scan(&book.BookName, &book.SourceURL); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
+
+func (db *Db) GetDeliveryPrefs(ctx context.Context, telegramId int64) (sender.Prefs, error) {
+	var prefs sender.Prefs
+	err := db.QueryRowContext(ctx, "SELECT method, address, format FROM delivery_prefs WHERE telegram_id = ?", telegramId).
+		Scan(&prefs.Method, &prefs.Address, &prefs.Format)
+	return prefs, err
+}
+
+func (db *Db) SetDeliveryPrefs(ctx context.Context, telegramId int64, prefs sender.Prefs) error {
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO delivery_prefs (telegram_id, method, address, format) VALUES (?, ?, ?, ?)
+        ON CONFLICT(telegram_id) DO UPDATE SET method = ?, address = ?, format = ?
+    `, telegramId, prefs.Method, prefs.Address, prefs.Format, prefs.Method, prefs.Address, prefs.Format)
+	return err
+}
+
+func (db *Db) GetConversationState(ctx context.Context, telegramId int64) (conversation.State, error) {
+	var state conversation.State
+	err := db.QueryRowContext(ctx, "SELECT step, region, email FROM user_state WHERE telegram_id = ?", telegramId).
+		Scan(&state.Step, &state.Region, &state.Email)
+	return state, err
+}
+
+func (db *Db) SetConversationState(ctx context.Context, telegramId int64, state conversation.State) error {
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO user_state (telegram_id, step, region, email) VALUES (?, ?, ?, ?)
+        ON CONFLICT(telegram_id) DO UPDATE SET step = ?, region = ?, email = ?
+    `, telegramId, state.Step, state.Region, state.Email, state.Step, state.Region, state.Email)
+	return err
+}
+
+func (db *Db) ClearConversationState(ctx context.Context, telegramId int64) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM user_state WHERE telegram_id = ?", telegramId)
+	return err
+}
+
+// GetUsageToday implements quota.UsageStore.
+func (db *Db) GetUsageToday(ctx context.Context, telegramId int64) (int, int64, error) {
+	var books int
+	var bytesSent int64
+
+	err := db.QueryRowContext(ctx, "SELECT books_sent, bytes_sent FROM quota_usage WHERE telegram_id = ? AND date = ?", telegramId, today()).
+		Scan(&books, &bytesSent)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+
+	return books, bytesSent, err
+}
+
+// RecordUsage implements quota.UsageStore.
+func (db *Db) RecordUsage(ctx context.Context, telegramId int64, fileSize int) error {
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO quota_usage (telegram_id, date, books_sent, bytes_sent) VALUES (?, ?, 1, ?)
+        ON CONFLICT(telegram_id, date) DO UPDATE SET books_sent = books_sent + 1, bytes_sent = bytes_sent + ?
+    `, telegramId, today(), fileSize, fileSize)
+	return err
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+func (db *Db) IsBanned(ctx context.Context, telegramId int64) (bool, error) {
+	var exists int
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM banned_users WHERE telegram_id = ?", telegramId).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *Db) BanUser(ctx context.Context, telegramId int64) error {
+	_, err := db.ExecContext(ctx, "INSERT OR IGNORE INTO banned_users (telegram_id) VALUES (?)", telegramId)
+	return err
+}
+
+// Stats are the aggregate counters shown by /stats.
+type Stats struct {
+	TotalUsers     int
+	TotalBooksSent int
+	BooksSentToday int
+}
+
+func (db *Db) GetStats(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&stats.TotalUsers); err != nil {
+		return Stats{}, err
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sent_books").Scan(&stats.TotalBooksSent); err != nil {
+		return Stats{}, err
+	}
+
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(SUM(books_sent), 0) FROM quota_usage WHERE date = ?", today()).Scan(&stats.BooksSentToday)
+	return stats, err
+}
+
+// EnqueueJob persists a new delivery job in the queued state.
+func (db *Db) EnqueueJob(ctx context.Context, job jobqueue.Job) error {
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO jobs (telegram_id, chat_id, kind, file_id, file_name, mime_type, url)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, job.TelegramID, job.ChatID, job.Kind, job.FileID, job.FileName, job.MimeType, job.URL)
+	return err
+}
+
+// ClaimJob atomically picks the oldest queued job whose backoff has
+// elapsed and marks it in_progress, so concurrent workers never claim
+// the same job twice. ok is false when there's nothing ready to claim.
+func (db *Db) ClaimJob(ctx context.Context) (job jobqueue.Job, ok bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return jobqueue.Job{}, false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+        SELECT id, telegram_id, chat_id, kind, file_id, file_name, mime_type, url, attempts
+        FROM jobs
+        WHERE state = ? AND next_attempt_at <= CURRENT_TIMESTAMP
+        ORDER BY id
+        LIMIT 1
+    `, jobqueue.StateQueued).Scan(&job.ID, &job.TelegramID, &job.ChatID, &job.Kind, &job.FileID, &job.FileName, &job.MimeType, &job.URL, &job.Attempts)
+	if err == sql.ErrNoRows {
+		return jobqueue.Job{}, false, nil
+	}
+	if err != nil {
+		return jobqueue.Job{}, false, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE jobs SET state = ? WHERE id = ?", jobqueue.StateInProgress, job.ID); err != nil {
+		return jobqueue.Job{}, false, err
+	}
+
+	return job, true, tx.Commit()
+}
+
+// MarkJobDone marks a job as successfully delivered.
+func (db *Db) MarkJobDone(ctx context.Context, jobId int64) error {
+	_, err := db.ExecContext(ctx, "UPDATE jobs SET state = ? WHERE id = ?", jobqueue.StateDone, jobId)
+	return err
+}
+
+// MarkJobFailed records a failed attempt, either rescheduling the job
+// with an exponential backoff or, past jobqueue.MaxAttempts, moving it
+// to the dead-letter state. deadLettered reports which happened.
+func (db *Db) MarkJobFailed(ctx context.Context, jobId int64, attempts int, cause error) (deadLettered bool, err error) {
+	if attempts >= jobqueue.MaxAttempts {
+		_, err = db.ExecContext(ctx, "UPDATE jobs SET state = ?, attempts = ?, last_error = ? WHERE id = ?",
+			jobqueue.StateDeadLetter, attempts, cause.Error(), jobId)
+		return true, err
+	}
+
+	nextAttemptAt := time.Now().UTC().Add(jobqueue.NextAttemptDelay(attempts))
+	_, err = db.ExecContext(ctx, "UPDATE jobs SET state = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		jobqueue.StateQueued, attempts, cause.Error(), nextAttemptAt, jobId)
+	return false, err
+}
+
+// MarkJobDeadLetter moves a job straight to the dead-letter state
+// without scheduling a retry, for failures a retry can't fix, such as a
+// daily quota that's already exhausted.
+func (db *Db) MarkJobDeadLetter(ctx context.Context, jobId int64, cause error) error {
+	_, err := db.ExecContext(ctx, "UPDATE jobs SET state = ?, last_error = ? WHERE id = ?", jobqueue.StateDeadLetter, cause.Error(), jobId)
 	return err
 }
 
+// RequeueInProgressJobs resets jobs left in_progress by a crash or
+// unclean shutdown back to queued, so they're picked up again on
+// startup instead of being lost.
+func (db *Db) RequeueInProgressJobs(ctx context.Context) error {
+	result, err := db.ExecContext(ctx, "UPDATE jobs SET state = ? WHERE state = ?", jobqueue.StateQueued, jobqueue.StateInProgress)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		slog.Info("requeued in-progress jobs left over from a previous run", "count", rows)
+	}
+
+	return nil
+}
+
+// RequeueDeadLetterJobs resurrects all of telegramId's dead-letter jobs
+// back to queued for /retry, returning how many were requeued.
+func (db *Db) RequeueDeadLetterJobs(ctx context.Context, telegramId int64) (int64, error) {
+	result, err := db.ExecContext(ctx, `
+        UPDATE jobs SET state = ?, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+        WHERE telegram_id = ? AND state = ?
+    `, jobqueue.StateQueued, telegramId, jobqueue.StateDeadLetter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 /*
  * Bot methods
  */
@@ -121,11 +413,26 @@ func NewBookToKindleBot(config BotConfig) (*BookToKindleBot, error) {
 		return nil, fmt.Errorf("error creating database: %w", err)
 	}
 
+	convCache, err := converter.NewCache("conversion-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error creating converter cache: %w", err)
+	}
+
+	quotaChecker := quota.NewChecker(db, quota.Limits{
+		MaxBooksPerDay: config.DailyBookLimit,
+		MaxBytesPerDay: config.DailyByteLimit,
+	})
+
 	return &BookToKindleBot{
 		db:             db,
 		config:         config,
 		telegramBotApi: telegramBotApi,
 		httpClient:     &http.Client{Timeout: config.DownloadTimeout},
+		senderFactory:  sender.NewFactory(telegramBotApi, config.BotEmail),
+		converter:      converter.NewDefaultConverter(),
+		convCache:      convCache,
+		quotaChecker:   quotaChecker,
+		concurrency:    quota.NewSemaphore(config.MaxWorkers),
 	}, nil
 }
 
@@ -147,23 +454,80 @@ func (b *BookToKindleBot) Start(ctx context.Context) error {
 		}
 	}()
 
+	if err := b.db.RequeueInProgressJobs(ctx); err != nil {
+		slog.Error("error requeuing in-progress jobs", "error", err)
+	}
+
+	var jobWorkers sync.WaitGroup
+	for i := 0; i < b.config.MaxWorkers; i++ {
+		jobWorkers.Add(1)
+		go func() {
+			defer jobWorkers.Done()
+			b.runJobWorker(ctx)
+		}()
+	}
+
 	updateConfig := tgbotapi.NewUpdate(0)
 	updateConfig.Timeout = int(time.Second * 60)
 	updates := b.telegramBotApi.GetUpdatesChan(updateConfig)
-	workerPool := make(chan struct{}, b.config.MaxWorkers)
 
+	var updateHandlers sync.WaitGroup
+loop:
 	for {
 		select {
 		case update := <-updates:
-			workerPool <- struct{}{}
+			b.concurrency.Acquire()
+			updateHandlers.Add(1)
 			go func(update tgbotapi.Update) {
-				defer func() { <-workerPool }()
+				defer updateHandlers.Done()
+				defer b.concurrency.Release()
 				b.handleUpdate(ctx, update)
 			}(update)
 		case <-ctx.Done():
-			return ctx.Err()
+			break loop
 		}
 	}
+
+	slog.Info("shutting down: draining in-flight updates and jobs...")
+	b.telegramBotApi.StopReceivingUpdates()
+	updateHandlers.Wait()
+	jobWorkers.Wait()
+	slog.Info("shutdown complete")
+
+	return nil
+}
+
+// runJobWorker claims queued jobs and processes them until ctx is
+// cancelled. A job already claimed runs against a detached context, so
+// a shutdown signal drains it instead of aborting it mid-delivery.
+func (b *BookToKindleBot) runJobWorker(ctx context.Context) {
+	const pollInterval = 2 * time.Second
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		job, ok, err := b.db.ClaimJob(ctx)
+		if err != nil {
+			slog.Error("error claiming job", "error", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		b.processJob(context.Background(), job)
+	}
 }
 
 func (b *BookToKindleBot) CleanUp(ctx context.Context) {
@@ -186,14 +550,25 @@ func (b *BookToKindleBot) CleanUp(ctx context.Context) {
 func (b *BookToKindleBot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
 	defer func() {
 		if r := recover(); r != nil {
-			slog.Error("recovered from panic in handleUpdate",
-				"error", r,
-				"user_id", update.Message.From.ID,
-				"chat_id", update.Message.Chat.ID,
-			)
+			slog.Error("recovered from panic in handleUpdate", "error", r, "update_id", update.UpdateID)
 		}
 	}()
 
+	if telegramId, ok := senderID(update); ok {
+		if banned, err := b.db.IsBanned(ctx, telegramId); err == nil && banned {
+			return
+		}
+	}
+
+	if update.CallbackQuery != nil {
+		b.handleCallbackQuery(ctx, update)
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
 	if update.Message.Document != nil {
 		b.handleDocument(ctx, update)
 		return
@@ -204,77 +579,400 @@ func (b *BookToKindleBot) handleUpdate(ctx context.Context, update tgbotapi.Upda
 		return
 	}
 
+	rawURL, isURL := extractURL(update.Message.Text)
+
+	if state, err := b.db.GetConversationState(ctx, update.Message.From.ID); err == nil && state.Step == conversation.StepEmail {
+		if isURL {
+			// A pasted URL clearly isn't an email reply; abandon the
+			// onboarding conversation instead of trapping the user into
+			// an "invalid email" loop when they meant to /fetch this.
+			if err := b.db.ClearConversationState(ctx, update.Message.From.ID); err != nil {
+				slog.Error("error clearing onboarding state", "error", err, "user_id", update.Message.From.ID)
+			}
+		} else {
+			b.handleOnboardingEmailReply(ctx, update, state)
+			return
+		}
+	}
+
+	if isURL {
+		b.handleURL(ctx, update, rawURL)
+		return
+	}
+
 	b.handleUnsupportedMessage(update)
 }
 
+// senderID returns the telegram user id behind update, whether it's a
+// message or a callback query, so checks like IsBanned apply uniformly
+// regardless of which kind of update the user drives.
+func senderID(update tgbotapi.Update) (int64, bool) {
+	if update.CallbackQuery != nil {
+		return update.CallbackQuery.From.ID, true
+	}
+	if update.Message != nil {
+		return update.Message.From.ID, true
+	}
+	return 0, false
+}
+
+// extractURL reports whether text is (just) a single http(s) URL, which
+// lets users paste a link instead of using /fetch explicitly.
+func extractURL(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") {
+		if !strings.ContainsAny(text, " \t\n") {
+			return text, true
+		}
+	}
+	return "", false
+}
+
 func (b *BookToKindleBot) handleUnsupportedMessage(update tgbotapi.Update) {
 	b.sendMessage(update.Message.Chat.ID, "Unsupported message type. Send me a PDF, EPUB, or MOBI file")
 }
 
+// handleDocument validates an uploaded document and hands it off to the
+// job queue; the actual download, conversion, and delivery happen in a
+// job worker so they survive a restart.
 func (b *BookToKindleBot) handleDocument(ctx context.Context, update tgbotapi.Update) {
-	kindleEmail, err := b.db.GetKindleEmail(ctx, update.Message.From.ID)
+	telegramId := update.Message.From.ID
+	chatId := update.Message.Chat.ID
+	doc := update.Message.Document
+
+	if _, err := b.deliveryPrefsOrDefault(ctx, telegramId); err != nil {
+		b.sendMessage(chatId, "Please set your Kindle email address first using /set_kindle_email")
+		return
+	}
+
+	if !supportedMimeTypes[doc.MimeType] {
+		b.sendMessage(chatId, "Unsupported file type. Try sending a PDF, EPUB, or MOBI file")
+		return
+	}
+
+	if doc.FileSize > b.config.MaxFileSize {
+		b.sendMessage(chatId, "File is too large. Maximum file size is 20MB")
+		return
+	}
+
+	if !b.checkQuota(ctx, telegramId, chatId, doc.FileSize) {
+		return
+	}
+
+	if err := b.db.EnqueueJob(ctx, jobqueue.Job{
+		TelegramID: telegramId,
+		ChatID:     chatId,
+		Kind:       jobqueue.KindDocument,
+		FileID:     doc.FileID,
+		FileName:   doc.FileName,
+		MimeType:   doc.MimeType,
+	}); err != nil {
+		slog.Error("error enqueuing document job", "error", err, "user_id", telegramId)
+		b.sendMessage(chatId, "Error queuing your file, please try again later")
+		return
+	}
+
+	b.sendMessage(chatId, "Queued. I'll convert and deliver it to your Kindle shortly")
+}
+
+// convertCached converts fileBytes to targetFormat, reusing a prior
+// conversion of the same input from the cache when one exists.
+func (b *BookToKindleBot) convertCached(ctx context.Context, fileBytes []byte, mimeType string, targetFormat string) ([]byte, error) {
+	key := converter.Key(fileBytes, targetFormat)
+	if cached, ok := b.convCache.Get(key); ok {
+		return cached, nil
+	}
+
+	converted, err := b.converter.Convert(ctx, fileBytes, mimeType, targetFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.convCache.Put(key, converted); err != nil {
+		slog.Error("error caching converted file", "error", err, "key", key)
+	}
+
+	return converted, nil
+}
+
+// replaceExt swaps name's file extension for newExt (given without a
+// leading dot).
+func replaceExt(name string, newExt string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + newExt
+}
+
+// checkQuota reports whether telegramId may send a book of fileSize
+// bytes right now, sending them a friendly explanation on chatId and
+// returning false if not.
+func (b *BookToKindleBot) checkQuota(ctx context.Context, telegramId int64, chatId int64, fileSize int) bool {
+	allowed, reason, resetsIn, err := b.quotaChecker.Allow(ctx, telegramId, fileSize)
+	if err != nil {
+		slog.Error("error checking quota", "error", err, "user_id", telegramId)
+		b.sendMessage(chatId, "Error checking your quota, please try again later")
+		return false
+	}
+
+	if !allowed {
+		message := reason
+		if resetsIn > 0 {
+			message = fmt.Sprintf("%s, resets in %s", reason, resetsIn.Round(time.Minute))
+		}
+		b.sendMessage(chatId, message)
+		return false
+	}
+
+	return true
+}
+
+// deliverBook sends book to telegramId through their delivery
+// preference and records it in sent_books and the quota ledger.
+// sourceURL is non-empty when the book came from a fetched URL rather
+// than an uploaded document.
+func (b *BookToKindleBot) deliverBook(ctx context.Context, telegramId int64, prefs sender.Prefs, book sender.Book, sourceURL string) error {
+	bookSender, err := b.senderFactory.Build(prefs.Method)
 	if err != nil {
-		b.sendMessage(update.Message.Chat.ID, "Please set your Kindle email address first using /set_kindle_email")
+		return fmt.Errorf("error building sender: %w", err)
+	}
+
+	if err := bookSender.Send(ctx, prefs.Address, book); err != nil {
+		return fmt.Errorf("error sending book: %w", err)
+	}
+
+	if err := b.quotaChecker.Record(ctx, telegramId, book.FileSize); err != nil {
+		slog.Error("error recording quota usage", "error", err, "user_id", telegramId)
+	}
+
+	if err := b.db.logSentBook(ctx, telegramId, book.FileName, book.FileSize, sourceURL); err != nil {
+		slog.Error("error logging sent book", "error", err, "user_id", telegramId, "file_name", book.FileName)
+	}
+
+	return nil
+}
+
+// handleURL validates a book/article URL and hands it off to the job
+// queue; the actual fetch and delivery happen in a job worker so they
+// survive a restart.
+func (b *BookToKindleBot) handleURL(ctx context.Context, update tgbotapi.Update, rawURL string) {
+	telegramId := update.Message.From.ID
+	chatId := update.Message.Chat.ID
+
+	if _, err := b.deliveryPrefsOrDefault(ctx, telegramId); err != nil {
+		b.sendMessage(chatId, "Please set your Kindle email address first using /set_kindle_email")
 		return
 	}
 
-	if !supportedMimeTypes[update.Message.Document.MimeType] {
-		b.sendMessage(update.Message.Chat.ID, "Unsupported file type. Try sending a PDF, EPUB, or MOBI file")
+	// Quota is checked once, in processURLJob, since the fetched size
+	// (and thus whether the byte cap is hit) isn't known until then.
+
+	if err := b.db.EnqueueJob(ctx, jobqueue.Job{
+		TelegramID: telegramId,
+		ChatID:     chatId,
+		Kind:       jobqueue.KindURL,
+		URL:        rawURL,
+	}); err != nil {
+		slog.Error("error enqueuing url job", "error", err, "user_id", telegramId, "url", rawURL)
+		b.sendMessage(chatId, "Error queuing that URL, please try again later")
 		return
 	}
 
-	if update.Message.Document.FileSize > b.config.MaxFileSize {
-		b.sendMessage(update.Message.Chat.ID, "File is too large. Maximum file size is 20MB")
+	b.sendMessage(chatId, "Queued. I'll fetch that and deliver it to your Kindle shortly")
+}
+
+// processJob runs a single durable job to completion, dispatching on
+// its kind.
+func (b *BookToKindleBot) processJob(ctx context.Context, job jobqueue.Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("recovered from panic in processJob", "error", r, "job_id", job.ID)
+			b.failJob(ctx, job, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	switch job.Kind {
+	case jobqueue.KindDocument:
+		b.processDocumentJob(ctx, job)
+	case jobqueue.KindURL:
+		b.processURLJob(ctx, job)
+	default:
+		slog.Error("unknown job kind", "job_id", job.ID, "kind", job.Kind)
+		b.deadLetterJob(ctx, job, fmt.Errorf("unknown job kind %q", job.Kind))
+	}
+}
+
+func (b *BookToKindleBot) processDocumentJob(ctx context.Context, job jobqueue.Job) {
+	prefs, err := b.deliveryPrefsOrDefault(ctx, job.TelegramID)
+	if err != nil {
+		b.failJob(ctx, job, fmt.Errorf("no delivery preference set: %w", err))
 		return
 	}
 
-	b.sendMessage(update.Message.Chat.ID, "Downloading file...")
+	fileBytes, err := b.downloadTelegramFile(job.FileID)
+	if err != nil {
+		slog.Error("error downloading file", "error", err, "user_id", job.TelegramID, "file_id", job.FileID)
+		b.failJob(ctx, job, err)
+		return
+	}
+
+	// Quota is re-checked here, not just at admission in handleDocument:
+	// a burst of uploads can all pass the admission check before any of
+	// them is actually delivered and recorded, so the daily cap has to
+	// be enforced again at the point usage is recorded.
+	if !b.checkQuota(ctx, job.TelegramID, job.ChatID, len(fileBytes)) {
+		b.deadLetterJob(ctx, job, fmt.Errorf("quota exceeded"))
+		return
+	}
+
+	mimeType := job.MimeType
+	fileName := job.FileName
+
+	prefFormat := prefs.Format
+	if mimeType == "application/epub+zip" && prefFormat != "" && prefFormat != "epub" {
+		converted, err := b.convertCached(ctx, fileBytes, mimeType, prefFormat)
+		if err != nil {
+			slog.Error("error converting book", "error", err, "user_id", job.TelegramID, "target_format", prefFormat)
+			if errors.Is(err, converter.ErrUnsupported) {
+				b.sendMessage(job.ChatID, "Can't convert that file to your preferred format on this server. Try /format epub instead")
+				b.deadLetterJob(ctx, job, err)
+				return
+			}
+			b.failJob(ctx, job, err)
+			return
+		}
+		fileBytes = converted
+		fileName = replaceExt(fileName, prefFormat)
+	}
+
+	if mimeType == "application/pdf" {
+		if optimized, err := b.convertCached(ctx, fileBytes, mimeType, "pdf"); err != nil {
+			slog.Error("error optimizing pdf, sending original", "error", err, "user_id", job.TelegramID)
+		} else {
+			fileBytes = optimized
+		}
+	}
 
-	fileBytes, err := b.downloadTelegramFile(update.Message.Document.FileID)
+	book := sender.Book{FileName: fileName, FileSize: len(fileBytes), Bytes: fileBytes}
+	if err := b.deliverBook(ctx, job.TelegramID, prefs, book, ""); err != nil {
+		slog.Error("error delivering book", "error", err, "user_id", job.TelegramID)
+		b.failJob(ctx, job, err)
+		return
+	}
+
+	b.completeJob(ctx, job)
+}
+
+func (b *BookToKindleBot) processURLJob(ctx context.Context, job jobqueue.Job) {
+	prefs, err := b.deliveryPrefsOrDefault(ctx, job.TelegramID)
 	if err != nil {
-		slog.Error("error downloading file", "error", err, "user_id", update.Message.From.ID, "file_id", update.Message.Document.FileID)
-		b.sendMessage(update.Message.Chat.ID, "Error downloading file, please try again later")
+		b.failJob(ctx, job, fmt.Errorf("no delivery preference set: %w", err))
 		return
 	}
 
-	b.sendMessage(update.Message.Chat.ID, "Download successful. Sending file to Kindle...")
+	result, err := fetcher.Fetch(ctx, b.httpClient, job.URL, int64(b.config.MaxFileSize))
+	if err != nil {
+		slog.Error("error fetching url", "error", err, "user_id", job.TelegramID, "url", job.URL)
+		if errors.Is(err, fetcher.ErrTooLarge) {
+			b.sendMessage(job.ChatID, "Fetched file is too large. Maximum file size is 20MB")
+			b.deadLetterJob(ctx, job, err)
+			return
+		}
+		b.failJob(ctx, job, err)
+		return
+	}
 
-	if err := b.sendEmail(kindleEmail, fileBytes, update.Message.Document.FileName); err != nil {
-		slog.Error("error sending email", "error", err, "user_id", update.Message.From.ID, "kindle_email", kindleEmail)
-		b.sendMessage(update.Message.Chat.ID, "Error sending email, please try again later")
+	if !b.checkQuota(ctx, job.TelegramID, job.ChatID, len(result.Bytes)) {
+		b.deadLetterJob(ctx, job, fmt.Errorf("quota exceeded"))
 		return
 	}
 
-	if err := b.db.logSentBook(ctx, update.Message.From.ID, update.Message.Document.FileName, update.Message.Document.FileSize); err != nil {
-		slog.Error("error logging sent book", "error", err, "user_id", update.Message.From.ID, "file_name", update.Message.Document.FileName)
+	book := sender.Book{FileName: result.FileName, FileSize: len(result.Bytes), Bytes: result.Bytes}
+	if err := b.deliverBook(ctx, job.TelegramID, prefs, book, job.URL); err != nil {
+		slog.Error("error delivering book", "error", err, "user_id", job.TelegramID)
+		b.failJob(ctx, job, err)
+		return
 	}
 
-	b.sendMessage(update.Message.Chat.ID, "Book sent to Kindle successfully")
+	b.completeJob(ctx, job)
 }
 
-func (b *BookToKindleBot) sendEmail(kindleEmail string, fileBytes []byte, fileName string) error {
-	m := gomail.NewMessage()
+// failJob records a failed attempt, leaving the job to retry with
+// backoff or, past jobqueue.MaxAttempts, moving it to the dead-letter
+// state and telling the user how to resurrect it.
+func (b *BookToKindleBot) failJob(ctx context.Context, job jobqueue.Job, cause error) {
+	deadLettered, err := b.db.MarkJobFailed(ctx, job.ID, job.Attempts+1, cause)
+	if err != nil {
+		slog.Error("error recording job failure", "error", err, "job_id", job.ID)
+	}
 
-	m.SetHeader("To", kindleEmail)
-	m.SetHeader("From", b.config.BotEmail)
-	m.SetHeader("Subject", "BookToKindleBot")
+	if deadLettered {
+		b.sendMessage(job.ChatID, "Giving up on that delivery after repeated failures. Use /retry to try again")
+	}
+}
 
-	m.Attach(fileName, gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := w.Write(fileBytes)
-		return err
-	}))
+// deadLetterJob moves job straight to the dead-letter state without
+// retrying, for failures a retry can't fix.
+func (b *BookToKindleBot) deadLetterJob(ctx context.Context, job jobqueue.Job, cause error) {
+	if err := b.db.MarkJobDeadLetter(ctx, job.ID, cause); err != nil {
+		slog.Error("error dead-lettering job", "error", err, "job_id", job.ID)
+	}
+}
+
+func (b *BookToKindleBot) completeJob(ctx context.Context, job jobqueue.Job) {
+	if err := b.db.MarkJobDone(ctx, job.ID); err != nil {
+		slog.Error("error marking job done", "error", err, "job_id", job.ID)
+	}
+	b.sendMessage(job.ChatID, "Book sent to Kindle successfully")
+}
 
-	d := gomail.NewDialer("email-smtp.us-east-1.amazonaws.com", 587, os.Getenv("AWS_SES_SMTP_USERNAME"), os.Getenv("AWS_SES_SMTP_PASSWORD"))
+func (b *BookToKindleBot) fetchCommand(ctx context.Context, update tgbotapi.Update) {
+	rawURL := strings.TrimSpace(update.Message.CommandArguments())
+	if rawURL == "" {
+		b.sendMessage(update.Message.Chat.ID, "Usage: /fetch <url>")
+		return
+	}
 
-	err := backoff.Retry(func() error {
-		return d.DialAndSend(m)
-	}, backoff.NewExponentialBackOff())
+	b.handleURL(ctx, update, rawURL)
+}
 
+func (b *BookToKindleBot) historyCommand(ctx context.Context, update tgbotapi.Update) {
+	books, err := b.db.GetSentBooksWithSource(ctx, update.Message.From.ID)
 	if err != nil {
-		return fmt.Errorf("error sending email: %w", err)
+		slog.Error("error fetching history", "error", err, "user_id", update.Message.From.ID)
+		b.sendMessage(update.Message.Chat.ID, "Error fetching your history, please try again later")
+		return
 	}
 
-	return nil
+	if len(books) == 0 {
+		b.sendMessage(update.Message.Chat.ID, "You haven't sent any books yet")
+		return
+	}
+
+	var lines []string
+	for _, book := range books {
+		if book.SourceURL != "" {
+			lines = append(lines, fmt.Sprintf("%s (%s)", book.BookName, book.SourceURL))
+		} else {
+			lines = append(lines, book.BookName)
+		}
+	}
+
+	b.sendMessage(update.Message.Chat.ID, "Your sent books:\n"+strings.Join(lines, "\n"))
+}
+
+// deliveryPrefsOrDefault returns the user's stored delivery preferences,
+// falling back to emailing their Kindle address via SES SMTP for users
+// who set a Kindle email before /set_delivery existed.
+func (b *BookToKindleBot) deliveryPrefsOrDefault(ctx context.Context, telegramId int64) (sender.Prefs, error) {
+	prefs, err := b.db.GetDeliveryPrefs(ctx, telegramId)
+	if err == nil {
+		return prefs, nil
+	}
+
+	kindleEmail, err := b.db.GetKindleEmail(ctx, telegramId)
+	if err != nil {
+		return sender.Prefs{}, err
+	}
+
+	return sender.Prefs{Method: sender.DefaultMethod, Address: kindleEmail}, nil
 }
 
 func (b *BookToKindleBot) sendMessage(chatId int64, text string) {
@@ -296,11 +994,94 @@ func (b *BookToKindleBot) handleCommand(ctx context.Context, update tgbotapi.Upd
 		b.helpCommand(update)
 	case "set_kindle_email":
 		b.setKindleEmailCommand(ctx, update)
+	case "set_delivery":
+		b.setDeliveryCommand(ctx, update)
+	case "fetch":
+		b.fetchCommand(ctx, update)
+	case "history":
+		b.historyCommand(ctx, update)
+	case "format":
+		b.formatCommand(ctx, update)
+	case "stats":
+		b.statsCommand(ctx, update)
+	case "ban":
+		b.banCommand(ctx, update)
+	case "retry":
+		b.retryCommand(ctx, update)
+	case "cancel":
+		b.cancelCommand(ctx, update)
 	default:
 		b.invalidCommand(update)
 	}
 }
 
+func (b *BookToKindleBot) isAdmin(telegramId int64) bool {
+	for _, id := range b.config.AdminIDs {
+		if id == telegramId {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BookToKindleBot) statsCommand(ctx context.Context, update tgbotapi.Update) {
+	if !b.isAdmin(update.Message.From.ID) {
+		b.invalidCommand(update)
+		return
+	}
+
+	stats, err := b.db.GetStats(ctx)
+	if err != nil {
+		slog.Error("error fetching stats", "error", err)
+		b.sendMessage(update.Message.Chat.ID, "Error fetching stats, please try again later")
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf(
+		"Users: %d\nBooks sent (all time): %d\nBooks sent today: %d",
+		stats.TotalUsers, stats.TotalBooksSent, stats.BooksSentToday,
+	))
+}
+
+func (b *BookToKindleBot) banCommand(ctx context.Context, update tgbotapi.Update) {
+	if !b.isAdmin(update.Message.From.ID) {
+		b.invalidCommand(update)
+		return
+	}
+
+	telegramId, err := strconv.ParseInt(strings.TrimSpace(update.Message.CommandArguments()), 10, 64)
+	if err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Usage: /ban <telegram_id>")
+		return
+	}
+
+	if err := b.db.BanUser(ctx, telegramId); err != nil {
+		slog.Error("error banning user", "error", err, "target_id", telegramId)
+		b.sendMessage(update.Message.Chat.ID, "Error banning that user, please try again later")
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf("Banned %d", telegramId))
+}
+
+// retryCommand resurrects all of the user's dead-letter deliveries by
+// requeuing them for the job workers to pick up again.
+func (b *BookToKindleBot) retryCommand(ctx context.Context, update tgbotapi.Update) {
+	n, err := b.db.RequeueDeadLetterJobs(ctx, update.Message.From.ID)
+	if err != nil {
+		slog.Error("error requeuing dead-letter jobs", "error", err, "user_id", update.Message.From.ID)
+		b.sendMessage(update.Message.Chat.ID, "Error retrying your failed deliveries, please try again later")
+		return
+	}
+
+	if n == 0 {
+		b.sendMessage(update.Message.Chat.ID, "You have no failed deliveries to retry")
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf("Retrying %d failed delivery(ies)", n))
+}
+
 func (b *BookToKindleBot) invalidCommand(update tgbotapi.Update) {
 	message := fmt.Sprintf("Unknown command: %s, use /help for available commands", update.Message.Command())
 	b.sendMessage(update.Message.Chat.ID, message)
@@ -308,7 +1089,7 @@ func (b *BookToKindleBot) invalidCommand(update tgbotapi.Update) {
 
 func (b *BookToKindleBot) startCommand(update tgbotapi.Update) {
 	message := fmt.Sprintf(`
-		Hello %s! Send me a PDF, EPUB, or MOBI file and I'll send it to your Kindle.
+		Hello %s! Send me a PDF, EPUB, or MOBI file, or just paste a URL, and I'll send it to your Kindle.
 		Use /set_kindle_email to set your Kindle email address and don't forget to whitelist %s in your Kindle settings.
 	`, update.Message.From.FirstName, b.config.BotEmail)
 
@@ -318,50 +1099,254 @@ func (b *BookToKindleBot) startCommand(update tgbotapi.Update) {
 func (b *BookToKindleBot) helpCommand(update tgbotapi.Update) {
 	message := `
 		Available commands:
-		/set_kindle_email <kindle_email_address> - set your Kindle email address
+		/set_kindle_email - walk through setting up your Kindle email address
+		/set_delivery <ses_smtp|smtp|telegram> [address] - choose how books are delivered to you
+		/fetch <url> - fetch a book or article from a URL and send it to your Kindle
+		/history - show the books you've sent, including their source URL
+		/format <epub|azw3|mobi> - set the format EPUBs are converted to before delivery
+		/retry - retry deliveries that failed permanently
+		/cancel - abandon the /set_kindle_email setup you're in the middle of
 		/help - show this help message
 	`
 	b.telegramBotApi.Send(tgbotapi.NewMessage(update.Message.Chat.ID, message))
 }
 
+// cancelCommand abandons any onboarding conversation in progress, so a
+// user stuck mid /set_kindle_email isn't forced to keep answering its
+// prompts.
+func (b *BookToKindleBot) cancelCommand(ctx context.Context, update tgbotapi.Update) {
+	if err := b.db.ClearConversationState(ctx, update.Message.From.ID); err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Error cancelling, please try again later")
+		slog.Error("error clearing conversation state", "error", err, "user_id", update.Message.From.ID)
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, "Cancelled")
+}
+
+// setKindleEmailCommand starts the onboarding conversation: pick a
+// region, enter an email, confirm a verification file arrived, confirm
+// the sender is whitelisted. The rest of the flow is driven by
+// handleCallbackQuery and handleOnboardingEmailReply.
 func (b *BookToKindleBot) setKindleEmailCommand(ctx context.Context, update tgbotapi.Update) {
-	args := update.Message.CommandArguments()
-	if args == "" {
-		b.sendMessage(update.Message.Chat.ID, "Please provide your Kindle email address")
+	state := conversation.State{Step: conversation.StepRegion}
+	if err := b.db.SetConversationState(ctx, update.Message.From.ID, state); err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Error starting setup, please try again later")
+		slog.Error("error starting onboarding", "error", err, "user_id", update.Message.From.ID)
 		return
 	}
 
-	kindleEmail, err := validateEmail(args)
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Which Kindle email domain do you use?")
+	msg.ReplyMarkup = conversation.RegionKeyboard()
+	b.telegramBotApi.Send(msg)
+}
+
+// handleCallbackQuery drives the onboarding conversation's inline
+// keyboard steps.
+func (b *BookToKindleBot) handleCallbackQuery(ctx context.Context, update tgbotapi.Update) {
+	query := update.CallbackQuery
+	b.telegramBotApi.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	if region, ok := conversation.RegionFromCallback(query.Data); ok {
+		b.handleOnboardingRegionChosen(ctx, query, region)
+		return
+	}
+
+	if query.Data == conversation.CallbackWhitelistDone {
+		b.handleOnboardingWhitelistConfirmed(ctx, query)
+		return
+	}
+}
+
+func (b *BookToKindleBot) handleOnboardingRegionChosen(ctx context.Context, query *tgbotapi.CallbackQuery, region string) {
+	state := conversation.State{Step: conversation.StepEmail, Region: region}
+	if err := b.db.SetConversationState(ctx, query.From.ID, state); err != nil {
+		b.sendMessage(query.Message.Chat.ID, "Error starting setup, please try again later")
+		slog.Error("error saving onboarding state", "error", err, "user_id", query.From.ID)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(query.Message.Chat.ID, fmt.Sprintf("Reply with your @%s email address", region))
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+	b.telegramBotApi.Send(msg)
+}
+
+func (b *BookToKindleBot) handleOnboardingEmailReply(ctx context.Context, update tgbotapi.Update, state conversation.State) {
+	kindleEmail, err := validateEmail(update.Message.Text, state.Region)
 	if err != nil {
 		b.sendMessage(update.Message.Chat.ID, err.Error())
 		return
 	}
 
-	if err := b.db.SetKindleEmail(ctx, update.Message.From.ID, kindleEmail); err != nil {
-		b.sendMessage(update.Message.Chat.ID, "Error setting Kindle email address, please try again later")
-		slog.Error("error setting kindle email", "error", err, "user_id", update.Message.From.ID, "kindle_email", kindleEmail)
+	state.Step = conversation.StepWhitelist
+	state.Email = kindleEmail
+	if err := b.db.SetConversationState(ctx, update.Message.From.ID, state); err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Error saving your email, please try again later")
+		slog.Error("error saving onboarding state", "error", err, "user_id", update.Message.From.ID)
+		return
+	}
+
+	b.sendVerificationFile(update.Message.Chat.ID, kindleEmail)
+
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf(
+		"Sent a verification file to %s. In your Amazon account, add %s to your approved personal document email list, then confirm below.",
+		kindleEmail, b.config.BotEmail,
+	))
+	msg.ReplyMarkup = conversation.WhitelistKeyboard()
+	b.telegramBotApi.Send(msg)
+}
+
+func (b *BookToKindleBot) sendVerificationFile(chatId int64, kindleEmail string) {
+	bookSender, err := b.senderFactory.Build(sender.DefaultMethod)
+	if err != nil {
+		slog.Error("error building sender for verification file", "error", err, "kindle_email", kindleEmail)
 		return
 	}
 
-	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf("Kindle email address set to %s successfully", kindleEmail))
+	book := sender.Book{
+		FileName: "book-to-kindle-bot-verification.txt",
+		Bytes:    []byte("This confirms BookToKindleBot can deliver to this address.\n"),
+	}
+	book.FileSize = len(book.Bytes)
+
+	if err := bookSender.Send(context.Background(), kindleEmail, book); err != nil {
+		slog.Error("error sending verification file", "error", err, "kindle_email", kindleEmail)
+	}
+}
+
+func (b *BookToKindleBot) handleOnboardingWhitelistConfirmed(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	state, err := b.db.GetConversationState(ctx, query.From.ID)
+	if err != nil || state.Step != conversation.StepWhitelist {
+		b.sendMessage(query.Message.Chat.ID, "Start over with /set_kindle_email")
+		return
+	}
+
+	if err := b.db.SetKindleEmail(ctx, query.From.ID, state.Email); err != nil {
+		b.sendMessage(query.Message.Chat.ID, "Error setting Kindle email address, please try again later")
+		slog.Error("error setting kindle email", "error", err, "user_id", query.From.ID, "kindle_email", state.Email)
+		return
+	}
+
+	if err := b.db.ClearConversationState(ctx, query.From.ID); err != nil {
+		slog.Error("error clearing onboarding state", "error", err, "user_id", query.From.ID)
+	}
+
+	b.sendMessage(query.Message.Chat.ID, fmt.Sprintf("Kindle email address set to %s successfully", state.Email))
+}
+
+func (b *BookToKindleBot) setDeliveryCommand(ctx context.Context, update tgbotapi.Update) {
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		b.sendMessage(update.Message.Chat.ID, "Usage: /set_delivery <ses_smtp|smtp|telegram> [address]")
+		return
+	}
+
+	method := sender.Method(args[0])
+
+	var address string
+	switch method {
+	case sender.MethodSESSMTP, sender.MethodSMTP:
+		if len(args) < 2 {
+			b.sendMessage(update.Message.Chat.ID, "Please provide the email address to deliver to")
+			return
+		}
+
+		kindleEmail, err := validateEmail(args[1], kindleEmailDomains...)
+		if err != nil {
+			b.sendMessage(update.Message.Chat.ID, err.Error())
+			return
+		}
+		address = kindleEmail
+	case sender.MethodTelegram:
+		address = fmt.Sprintf("%d", update.Message.Chat.ID)
+	default:
+		b.sendMessage(update.Message.Chat.ID, "Unknown delivery method, use one of: ses_smtp, smtp, telegram")
+		return
+	}
+
+	prefs := sender.Prefs{Method: method, Address: address}
+	if err := b.db.SetDeliveryPrefs(ctx, update.Message.From.ID, prefs); err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Error setting delivery preference, please try again later")
+		slog.Error("error setting delivery prefs", "error", err, "user_id", update.Message.From.ID, "method", method)
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf("Delivery method set to %s successfully", method))
+}
+
+var supportedTargetFormats = map[string]bool{
+	"epub": true,
+	"azw3": true,
+	"mobi": true,
+}
+
+func (b *BookToKindleBot) formatCommand(ctx context.Context, update tgbotapi.Update) {
+	format := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if !supportedTargetFormats[format] {
+		b.sendMessage(update.Message.Chat.ID, "Usage: /format <epub|azw3|mobi>")
+		return
+	}
+
+	telegramId := update.Message.From.ID
+
+	// Stored alongside the rest of delivery_prefs rather than on users,
+	// since preferred format applies regardless of delivery method and
+	// a telegram-delivery user may never have a users row at all.
+	prefs, err := b.deliveryPrefsOrDefault(ctx, telegramId)
+	if err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Please set your delivery method first using /set_delivery or /set_kindle_email")
+		return
+	}
+
+	prefs.Format = format
+	if err := b.db.SetDeliveryPrefs(ctx, telegramId, prefs); err != nil {
+		b.sendMessage(update.Message.Chat.ID, "Error setting preferred format, please try again later")
+		slog.Error("error setting preferred format", "error", err, "user_id", telegramId, "format", format)
+		return
+	}
+
+	b.sendMessage(update.Message.Chat.ID, fmt.Sprintf("Preferred format set to %s successfully", format))
 }
 
 /*
  * Helper functions
  */
 
-func validateEmail(email string) (string, error) {
+// parseAdminIDs parses the comma-separated ADMIN_IDS env var, skipping
+// any entries that aren't valid telegram ids.
+func parseAdminIDs(raw string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			slog.Warn("ignoring invalid ADMIN_IDS entry", "value", part)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func validateEmail(email string, allowedDomains ...string) (string, error) {
 	address, err := mail.ParseAddress(email)
 
 	if err != nil {
 		return "", fmt.Errorf("invalid email address: %w", err)
 	}
 
-	if !strings.HasSuffix(address.Address, "@kindle.com") {
-		return "", fmt.Errorf("email address is not a kindle email address")
+	for _, domain := range allowedDomains {
+		if strings.HasSuffix(address.Address, "@"+domain) {
+			return email, nil
+		}
 	}
 
-	return email, nil
+	return "", fmt.Errorf("email address must end in %s", strings.Join(allowedDomains, " or "))
 }
 
 func (b *BookToKindleBot) downloadTelegramFile(fileId string) ([]byte, error) {
@@ -412,9 +1397,12 @@ func main() {
 		DownloadTimeout: 30 * time.Second,
 		MaxFileSize:     20 * 1024 * 1024,
 		MaxWorkers:      10,
+		DailyBookLimit:  20,
+		DailyByteLimit:  200 * 1024 * 1024,
 		DbPath:          os.Getenv("DB_PATH"),
 		BotEmail:        os.Getenv("BOT_EMAIL"),
 		TelegramToken:   os.Getenv("TELEGRAM_BOT_TOKEN"),
+		AdminIDs:        parseAdminIDs(os.Getenv("ADMIN_IDS")),
 	})
 
 	if err != nil {
@@ -426,6 +1414,14 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		slog.Info("received shutdown signal, draining in-flight work", "signal", sig)
+		cancel()
+	}()
+
 	if err := bookToKindleBot.Start(ctx); err != nil {
 		slog.Error("error starting bot", "error", err)
 	}